@@ -0,0 +1,202 @@
+// Package bindings generates Lua metatables for Go domain structs,
+// following the approach used by milla's registerStrucAsLuaMetaTable:
+// each registered type gets a `new` constructor that builds an instance
+// from a table of named fields, and an `__index` that first checks a set
+// of explicitly registered methods before falling back to reflective
+// field lookup. This lets Lua scripts write `Conveyor.new{id="c1"}` and
+// `block:connect(other)` directly against real Go structs, instead of
+// building nested tables that Go then has to re-parse.
+package bindings
+
+import (
+	"fmt"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+// Methods maps a Lua-visible method name to its Go implementation. Each
+// implementation pulls its receiver (and any userdata arguments) out of L
+// with checkStruct.
+type Methods map[string]lua.LGFunction
+
+// Register builds a metatable named `name` for *T and installs it as a
+// global in L. `name.new{...}` constructs an instance, populating fields
+// from the table argument by matching `lua:"..."` tags; `methods` is
+// consulted by __index before falling back to reflective field access.
+func Register[T any](L *lua.LState, name string, methods Methods) {
+	mt := L.NewTypeMetatable(name)
+
+	L.SetField(mt, "new", L.NewFunction(func(L *lua.LState) int {
+		v := reflect.New(reflect.TypeOf(*new(T)))
+		if tbl, ok := L.Get(1).(*lua.LTable); ok {
+			if err := populate(tbl, v.Elem()); err != nil {
+				L.RaiseError("bindings: %v", err)
+			}
+		}
+
+		ud := L.NewUserData()
+		ud.Value = v.Interface()
+		L.SetMetatable(ud, mt)
+		L.Push(ud)
+		return 1
+	}))
+
+	L.SetField(mt, "__index", L.NewFunction(func(L *lua.LState) int {
+		self := checkStruct[T](L, 1)
+		key := L.CheckString(2)
+
+		if fn, ok := methods[key]; ok {
+			L.Push(L.NewFunction(fn))
+			return 1
+		}
+
+		v := reflect.ValueOf(self).Elem()
+		if i, ok := fieldIndex(v.Type(), key); ok {
+			L.Push(toLua(L, v.Field(i)))
+			return 1
+		}
+
+		L.Push(lua.LNil)
+		return 1
+	}))
+
+	L.SetGlobal(name, mt)
+}
+
+// checkStruct pulls the *T out of the userdata at stack position n,
+// raising a Lua argument error if the value there isn't one.
+func checkStruct[T any](L *lua.LState, n int) *T {
+	ud, ok := L.Get(n).(*lua.LUserData)
+	if !ok {
+		L.ArgError(n, fmt.Sprintf("expected %T", *new(T)))
+		return nil
+	}
+	t, ok := ud.Value.(*T)
+	if !ok {
+		L.ArgError(n, fmt.Sprintf("expected %T, got %T", *new(T), ud.Value))
+		return nil
+	}
+	return t
+}
+
+// fieldIndex finds the struct field tagged `lua:"key"` on t, if any.
+func fieldIndex(t reflect.Type, key string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("lua") == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// populate assigns t's tagged fields into v from the matching entries of
+// the Lua table tbl.
+func populate(tbl *lua.LTable, v reflect.Value) error {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("lua")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		lv := tbl.RawGetString(tag)
+		if lv == lua.LNil {
+			continue
+		}
+		if err := assignField(lv, v.Field(i)); err != nil {
+			return fmt.Errorf("field %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+func assignField(lv lua.LValue, field reflect.Value) error {
+	switch field.Kind() {
+	case reflect.String:
+		s, ok := lv.(lua.LString)
+		if !ok {
+			return fmt.Errorf("expected string, got %s", lv.Type())
+		}
+		field.SetString(string(s))
+	case reflect.Float64, reflect.Float32:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return fmt.Errorf("expected number, got %s", lv.Type())
+		}
+		field.SetFloat(float64(n))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return fmt.Errorf("expected number, got %s", lv.Type())
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, ok := lv.(lua.LBool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %s", lv.Type())
+		}
+		field.SetBool(bool(b))
+	case reflect.Ptr:
+		ud, ok := lv.(*lua.LUserData)
+		if !ok {
+			return fmt.Errorf("expected userdata, got %s", lv.Type())
+		}
+		pv := reflect.ValueOf(ud.Value)
+		if !pv.IsValid() || !pv.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("cannot assign %T to %s", ud.Value, field.Type())
+		}
+		field.Set(pv)
+	default:
+		return fmt.Errorf("unsupported field kind %s (build it with a method call instead)", field.Kind())
+	}
+	return nil
+}
+
+// toLua converts a field value back into a Lua value; pointers are
+// re-boxed as plain userdata holding the same Go pointer. No metatable is
+// attached to that userdata, so fields and methods cannot be reached
+// through it from Lua.
+func toLua(L *lua.LState, v reflect.Value) lua.LValue {
+	switch v.Kind() {
+	case reflect.String:
+		return lua.LString(v.String())
+	case reflect.Float64, reflect.Float32:
+		return lua.LNumber(v.Float())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(v.Int())
+	case reflect.Bool:
+		return lua.LBool(v.Bool())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return lua.LNil
+		}
+		ud := L.NewUserData()
+		ud.Value = v.Interface()
+		return ud
+	default:
+		return lua.LNil
+	}
+}
+
+// blockConnect implements Block:connect(other), linking self to other by
+// appending a new Connection.
+func blockConnect(L *lua.LState) int {
+	self := checkStruct[model.Block](L, 1)
+	other := checkStruct[model.Block](L, 2)
+	self.Connections = append(self.Connections, &model.Connection{To: other})
+	return 0
+}
+
+// RegisterDomainTypes installs Conveyor, Block and Source (from package
+// model) as Lua globals backed by real Go structs, so a setup script can
+// build the topology with e.g. `Conveyor.new{id="c1"}` and
+// `block:connect(other)` instead of nested tables.
+func RegisterDomainTypes(L *lua.LState) {
+	Register[model.Conveyor](L, "Conveyor", nil)
+	Register[model.Block](L, "Block", Methods{
+		"connect": blockConnect,
+	})
+	Register[model.Source](L, "Source", nil)
+}
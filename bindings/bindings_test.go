@@ -0,0 +1,48 @@
+package bindings
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+// TestRegisteredStructsFeedModelLoad exercises the full pipeline: a
+// setup script built with the bindings-provided constructors must still
+// be consumable by model.Load, the same way a script built from plain
+// nested tables is.
+func TestRegisteredStructsFeedModelLoad(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterDomainTypes(L)
+
+	script := `
+		local b1 = Block.new{id="b1", kind="source"}
+		local b2 = Block.new{id="b2", kind="sink"}
+		b1:connect(b2)
+
+		local cn = { conveyors = { { id = "c1", blocks = { b1, b2 } } } }
+		local sources = { Source.new{id="s1", block=b1} }
+		return { cn, sources }
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("DoString: %v", err)
+	}
+
+	aim, err := model.Load(L)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	blocks := aim.Network.Conveyors[0].Blocks
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if len(blocks[0].Connections) != 1 || blocks[0].Connections[0].To.ID != "b2" {
+		t.Fatalf("connect() did not produce a Connection to b2: %+v", blocks[0].Connections)
+	}
+	if aim.Sources[0].Block.ID != "b1" {
+		t.Fatalf("source.block mismatch: %+v", aim.Sources[0].Block)
+	}
+}
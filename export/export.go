@@ -0,0 +1,169 @@
+// Package export serializes a loaded conveyor network to formats meant
+// for humans and other tooling: Graphviz DOT for visualization, and a
+// stable JSON document for diffing. The DOT edge traversal uses a visited
+// set, and the JSON form only walks each conveyor's block list and refers
+// to blocks by ID, so a cyclic graph (possible since package model shares
+// Blocks by pointer) still produces a finite amount of output.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+// DOT writes a's topology as a Graphviz DOT graph: each Conveyor becomes
+// a subgraph cluster containing its blocks, each Source becomes a
+// distinctly-shaped node pointing at the block it feeds, and each
+// connection becomes a directed edge labeled with its metadata, if any.
+func DOT(w io.Writer, a *model.Aim) error {
+	fmt.Fprintln(w, "digraph aim {")
+
+	for i, conv := range a.Network.Conveyors {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "    label = %q;\n", conv.ID)
+		for _, b := range conv.Blocks {
+			fmt.Fprintf(w, "    %q [shape=box, label=\"%s\\n%s\"];\n", blockNode(b), dotEscape(b.ID), dotEscape(b.Kind))
+		}
+		fmt.Fprintln(w, "  }")
+	}
+
+	for _, src := range a.Sources {
+		node := sourceNode(src)
+		fmt.Fprintf(w, "  %q [shape=doublecircle, label=%q];\n", node, src.ID)
+		if src.Block != nil {
+			fmt.Fprintf(w, "  %q -> %q;\n", node, blockNode(src.Block))
+		}
+	}
+
+	visited := make(map[*model.Block]bool)
+	for _, conv := range a.Network.Conveyors {
+		for _, b := range conv.Blocks {
+			writeDOTEdges(w, b, visited)
+		}
+	}
+
+	fmt.Fprintln(w, "}")
+	return nil
+}
+
+func writeDOTEdges(w io.Writer, b *model.Block, visited map[*model.Block]bool) {
+	if visited[b] {
+		return
+	}
+	visited[b] = true
+
+	for _, c := range b.Connections {
+		if c.To == nil {
+			continue
+		}
+		if c.Label != "" {
+			fmt.Fprintf(w, "  %q -> %q [label=%q];\n", blockNode(b), blockNode(c.To), c.Label)
+		} else {
+			fmt.Fprintf(w, "  %q -> %q;\n", blockNode(b), blockNode(c.To))
+		}
+	}
+	for _, c := range b.Connections {
+		if c.To != nil {
+			writeDOTEdges(w, c.To, visited)
+		}
+	}
+}
+
+func blockNode(b *model.Block) string {
+	return "block_" + b.ID
+}
+
+func sourceNode(s *model.Source) string {
+	return "source_" + s.ID
+}
+
+// dotEscape escapes quotes and backslashes in s so it can be embedded in a
+// DOT quoted string literal without disturbing an already-literal "\n"
+// record-label separator placed around it.
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return s
+}
+
+// jsonDoc mirrors model.Aim but references blocks by ID instead of
+// pointer, so it can be marshalled with the standard library even when
+// the underlying graph is cyclic, and sorts every level by ID so the
+// output is stable across runs.
+type jsonDoc struct {
+	Conveyors []jsonConveyor `json:"conveyors"`
+	Sources   []jsonSource   `json:"sources"`
+}
+
+type jsonConveyor struct {
+	ID     string      `json:"id"`
+	Blocks []jsonBlock `json:"blocks"`
+}
+
+type jsonBlock struct {
+	ID          string           `json:"id"`
+	Kind        string           `json:"kind"`
+	Connections []jsonConnection `json:"connections"`
+}
+
+type jsonConnection struct {
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+type jsonSource struct {
+	ID    string `json:"id"`
+	Block string `json:"block"`
+}
+
+// JSON writes a's topology as a stable, indented JSON document.
+func JSON(w io.Writer, a *model.Aim) error {
+	var doc jsonDoc
+
+	for _, conv := range a.Network.Conveyors {
+		jc := jsonConveyor{ID: conv.ID}
+		for _, b := range conv.Blocks {
+			jc.Blocks = append(jc.Blocks, toJSONBlock(b))
+		}
+		sort.Slice(jc.Blocks, func(i, j int) bool { return jc.Blocks[i].ID < jc.Blocks[j].ID })
+		doc.Conveyors = append(doc.Conveyors, jc)
+	}
+	sort.Slice(doc.Conveyors, func(i, j int) bool { return doc.Conveyors[i].ID < doc.Conveyors[j].ID })
+
+	for _, src := range a.Sources {
+		js := jsonSource{ID: src.ID}
+		if src.Block != nil {
+			js.Block = src.Block.ID
+		}
+		doc.Sources = append(doc.Sources, js)
+	}
+	sort.Slice(doc.Sources, func(i, j int) bool { return doc.Sources[i].ID < doc.Sources[j].ID })
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func toJSONBlock(b *model.Block) jsonBlock {
+	jb := jsonBlock{ID: b.ID, Kind: b.Kind}
+	for _, c := range b.Connections {
+		jc := jsonConnection{Label: c.Label}
+		if c.To != nil {
+			jc.To = c.To.ID
+		}
+		jb.Connections = append(jb.Connections, jc)
+	}
+	sort.Slice(jb.Connections, func(i, j int) bool {
+		a, b := jb.Connections[i], jb.Connections[j]
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Label < b.Label
+	})
+	return jb
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+func sampleAim() *model.Aim {
+	b1 := &model.Block{ID: "b1", Kind: "belt"}
+	b2 := &model.Block{ID: "b2", Kind: "belt"}
+	b1.Connections = []*model.Connection{{To: b2, Label: "out"}}
+	return &model.Aim{
+		Network: &model.ConveyorNetwork{
+			Conveyors: []*model.Conveyor{{ID: "c1", Blocks: []*model.Block{b2, b1}}},
+		},
+		Sources: []*model.Source{{ID: "s1", Block: b1}},
+	}
+}
+
+func TestJSONIsStableRegardlessOfInputOrder(t *testing.T) {
+	a := sampleAim()
+
+	var buf1 bytes.Buffer
+	if err := JSON(&buf1, a); err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+
+	blocks := a.Network.Conveyors[0].Blocks
+	blocks[0], blocks[1] = blocks[1], blocks[0]
+
+	var buf2 bytes.Buffer
+	if err := JSON(&buf2, a); err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+
+	if buf1.String() != buf2.String() {
+		t.Errorf("JSON output changed when input block order changed:\n%s\nvs\n%s", buf1.String(), buf2.String())
+	}
+}
+
+func TestDOTLabelUsesSingleBackslashN(t *testing.T) {
+	a := sampleAim()
+
+	var buf bytes.Buffer
+	if err := DOT(&buf, a); err != nil {
+		t.Fatalf("DOT: %v", err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, `\\n`) {
+		t.Errorf("DOT output contains a double-escaped newline:\n%s", out)
+	}
+	if !strings.Contains(out, `b1\nbelt`) {
+		t.Errorf("expected a single-escaped block label, got:\n%s", out)
+	}
+}
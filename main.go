@@ -1,13 +1,35 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"os"
 
 	lua "github.com/yuin/gopher-lua"
+
+	"github.com/AndreiNekrasOn/aim/bindings"
+	"github.com/AndreiNekrasOn/aim/export"
+	"github.com/AndreiNekrasOn/aim/model"
+	"github.com/AndreiNekrasOn/aim/plugin"
+	"github.com/AndreiNekrasOn/aim/sim"
 )
 
+// pluginDir is where plugin scripts are discovered from.
+const pluginDir = "lua/plugins"
+
+// simTicks is how many ticks the demo simulation runs for.
+const simTicks = 10
+
 func main() {
+	exportFormat := flag.String("export", "", "export the loaded topology as \"dot\" or \"json\" to stdout instead of running the demo")
+	flag.Parse()
+
+	scriptPath := "lua/setup.lua"
+	if flag.NArg() > 0 {
+		scriptPath = flag.Arg(0)
+	}
+
 	L := lua.NewState()
 	defer L.Close()
 
@@ -24,64 +46,72 @@ func main() {
 	newPath := fmt.Sprintf("lua/?.lua;lua/?/init.lua;lua/lib/?.lua;%s", currentPathValue.String())
 	L.SetField(packageTable, "path", lua.LString(newPath))
 
-	// Optional: Debug output
+	// Optional: Debug output. Goes to stderr so it never ends up mixed
+	// into -export's stdout output.
 	finalPath := L.ToStringMeta(L.GetField(packageTable, "path"))
-	fmt.Println("Resolved Lua package.path:", finalPath)
-	// ---
+	log.Println("Resolved Lua package.path:", finalPath)
+
+	// Register Conveyor/Block/Source as Lua-constructible metatables
+	// before setup.lua runs, so it can build the topology directly.
+	bindings.RegisterDomainTypes(L)
 
 	// Load and run setup.lua
-	if err := L.DoFile("lua/setup.lua"); err != nil {
+	if err := L.DoFile(scriptPath); err != nil {
 		log.Fatal("Failed to load setup.lua:", err)
 	}
 
-	// Get returned table: { aim.cn, aim.sources }
-	ret := L.Get(-1) // top of stack
-	if tbl, ok := ret.(*lua.LTable); ok {
-		// First return value: aim.cn
-		cn := L.GetTable(tbl, lua.LNumber(1))
-		if cnTbl, ok := cn.(*lua.LTable); ok {
-			// Get cn.conveyors
-			conveyors := L.GetField(cnTbl, "conveyors")
-			if convTbl, ok := conveyors.(*lua.LTable); ok {
-				fmt.Println("\n=== Conveyor IDs ===")
-				convTbl.ForEach(func(key lua.LValue, value lua.LValue) {
-					if conv, ok := value.(*lua.LTable); ok {
-						id := L.GetField(conv, "id")
-						if idStr, ok := id.(lua.LString); ok {
-							fmt.Println("Conveyor ID:", string(idStr))
-						}
-					}
-				})
-			}
-		}
+	// Marshal the Lua return value { aim.cn, aim.sources } into a typed,
+	// cycle-safe Go graph.
+	aim, err := model.Load(L)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Second return value: aim.sources
-		sources := L.GetTable(tbl, lua.LNumber(2))
-		if srcTbl, ok := sources.(*lua.LTable); ok {
-			fmt.Println("\n=== Source Block Chains ===")
-			srcTbl.ForEach(func(key lua.LValue, value lua.LValue) {
-				if src, ok := value.(*lua.LTable); ok {
-					chainLen := countChain(L, src, 0)
-					fmt.Printf("Source chain length: %d\n", chainLen)
-				}
-			})
+	if *exportFormat != "" {
+		switch *exportFormat {
+		case "dot":
+			err = export.DOT(os.Stdout, aim)
+		case "json":
+			err = export.JSON(os.Stdout, aim)
+		default:
+			log.Fatalf("unknown -export format %q (want dot or json)", *exportFormat)
+		}
+		if err != nil {
+			log.Fatal(err)
 		}
-	} else {
-		log.Fatal("setup.lua did not return a table")
+		return
 	}
-}
 
-// Recursively count connected blocks
-func countChain(L *lua.LState, block *lua.LTable, depth int) int {
-	connections := L.GetField(block, "connections")
-	if connTbl, ok := connections.(*lua.LTable); ok {
-		if connTbl.Len() == 0 {
-			return depth
-		}
-		firstConn := L.GetTable(connTbl, lua.LNumber(1))
-		if nextBlock, ok := firstConn.(*lua.LTable); ok {
-			return countChain(L, nextBlock, depth+1)
+	fmt.Println("\n=== Conveyor IDs ===")
+	for _, conv := range aim.Network.Conveyors {
+		fmt.Println("Conveyor ID:", conv.ID)
+	}
+
+	fmt.Println("\n=== Source Block Chains ===")
+	for _, src := range aim.Sources {
+		fmt.Printf("Source chain length: %d\n", model.ChainLength(src))
+	}
+
+	// Load plugins and let them react to the topology we just built.
+	plugins, err := plugin.Load(pluginDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer plugins.Close()
+
+	if err := plugins.FireOnLoad(aim); err != nil {
+		log.Fatal(err)
+	}
+	for _, conv := range aim.Network.Conveyors {
+		for _, block := range conv.Blocks {
+			if err := plugins.FireOnBlock(block); err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
-	return depth
+	// Run the loaded topology as an executable simulation for a bit,
+	// firing plugins' on_tick hooks once per step.
+	if err := sim.Run(L, aim, simTicks, plugins.FireOnTick); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,259 @@
+// Package model defines a typed Go representation of the conveyor network
+// topology produced by the Lua configuration scripts, together with a
+// gluamapper-style marshaller that converts the raw *lua.LTable values
+// returned by setup.lua into these structs.
+package model
+
+import (
+	"fmt"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Aim is the top-level result of loading a Lua configuration: the
+// conveyor network topology plus the list of item sources that feed it.
+type Aim struct {
+	Network *ConveyorNetwork
+	Sources []*Source
+}
+
+// ConveyorNetwork is the marshalled form of aim.cn.
+type ConveyorNetwork struct {
+	Conveyors []*Conveyor `lua:"conveyors"`
+}
+
+// Conveyor is a single conveyor line made up of blocks.
+type Conveyor struct {
+	ID     string   `lua:"id"`
+	Blocks []*Block `lua:"blocks"`
+}
+
+// Block is one node in the conveyor graph. Blocks form a graph, not a
+// tree: two blocks may point at each other, and the same block may be
+// reachable through more than one path, so callers must track visited
+// blocks when traversing Connections.
+type Block struct {
+	ID          string         `lua:"id"`
+	Kind        string         `lua:"kind"`
+	Connections []*Connection  `lua:"connections"`
+	Behavior    *lua.LFunction `lua:"behavior"`
+}
+
+// Connection is a directed edge from a Block to the next Block in the
+// chain, with an optional label carried over from the Lua table.
+type Connection struct {
+	To    *Block `lua:"to"`
+	Label string `lua:"label"`
+}
+
+// Source is an entry point that feeds items into a Block.
+type Source struct {
+	ID       string         `lua:"id"`
+	Block    *Block         `lua:"block"`
+	Behavior *lua.LFunction `lua:"behavior"`
+}
+
+// Load reads the value on top of L's stack -- the two-element table
+// { aim.cn, aim.sources } returned by setup.lua -- and marshals it into a
+// typed, cycle-safe *Aim graph. Blocks are identity-mapped by their
+// backing *lua.LTable, so a block reachable through more than one path
+// (including a cycle) is only marshalled once and shared by pointer.
+func Load(L *lua.LState) (*Aim, error) {
+	ret := L.Get(-1)
+	tbl, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("model: setup.lua did not return a table")
+	}
+
+	seen := make(map[*lua.LTable]*Block)
+
+	cnVal := L.GetTable(tbl, lua.LNumber(1))
+	cnTbl, ok := cnVal.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("model: aim.cn is not a table")
+	}
+	network := &ConveyorNetwork{}
+	if err := decode(cnTbl, reflect.ValueOf(network).Elem(), seen); err != nil {
+		return nil, fmt.Errorf("model: decoding conveyor network: %w", err)
+	}
+
+	srcVal := L.GetTable(tbl, lua.LNumber(2))
+	srcTbl, ok := srcVal.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("model: aim.sources is not a table")
+	}
+	var sources []*Source
+	if err := decodeSlice(srcTbl, reflect.ValueOf(&sources).Elem(), seen); err != nil {
+		return nil, fmt.Errorf("model: decoding sources: %w", err)
+	}
+
+	return &Aim{Network: network, Sources: sources}, nil
+}
+
+// decode populates the exported fields of the struct value v from the Lua
+// table t, matching fields by their `lua:"..."` tag.
+func decode(t *lua.LTable, v reflect.Value, seen map[*lua.LTable]*Block) error {
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("decode target must be a struct, got %s", v.Kind())
+	}
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("lua")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		lv := t.RawGetString(tag)
+		if lv == lua.LNil {
+			continue
+		}
+		if err := assign(lv, v.Field(i), seen); err != nil {
+			return fmt.Errorf("field %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// assign converts a single Lua value into field, dispatching on field's Go
+// kind the way gluamapper dispatches on LValue.Type().
+func assign(lv lua.LValue, field reflect.Value, seen map[*lua.LTable]*Block) error {
+	switch field.Kind() {
+	case reflect.String:
+		s, ok := lv.(lua.LString)
+		if !ok {
+			return fmt.Errorf("expected string, got %s", lv.Type())
+		}
+		field.SetString(string(s))
+	case reflect.Float64, reflect.Float32:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return fmt.Errorf("expected number, got %s", lv.Type())
+		}
+		field.SetFloat(float64(n))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return fmt.Errorf("expected number, got %s", lv.Type())
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, ok := lv.(lua.LBool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %s", lv.Type())
+		}
+		field.SetBool(bool(b))
+	case reflect.Ptr:
+		if field.Type() == reflect.TypeOf((*lua.LFunction)(nil)) {
+			fn, ok := lv.(*lua.LFunction)
+			if !ok {
+				return fmt.Errorf("expected function, got %s", lv.Type())
+			}
+			field.Set(reflect.ValueOf(fn))
+			return nil
+		}
+		switch nested := lv.(type) {
+		case *lua.LTable:
+			return assignPtr(nested, field, seen)
+		case *lua.LUserData:
+			// Built directly via bindings.Register (e.g. Block.new{...});
+			// the userdata already holds the real Go pointer, so there is
+			// nothing left to marshal -- just reuse it.
+			return assignUserData(nested, field)
+		default:
+			return fmt.Errorf("expected table or userdata, got %s", lv.Type())
+		}
+	case reflect.Slice:
+		nested, ok := lv.(*lua.LTable)
+		if !ok {
+			return fmt.Errorf("expected table, got %s", lv.Type())
+		}
+		return decodeSlice(nested, field, seen)
+	default:
+		return fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+	return nil
+}
+
+// assignPtr allocates a new pointer of field's element type and decodes t
+// into it. Blocks are special-cased: they are resolved through seen so a
+// table encountered a second time reuses the same *Block instead of being
+// re-marshalled, which is what makes cyclic graphs safe to build.
+func assignPtr(t *lua.LTable, field reflect.Value, seen map[*lua.LTable]*Block) error {
+	elemType := field.Type().Elem()
+	if elemType == reflect.TypeOf(Block{}) {
+		b, err := decodeBlock(t, seen)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(b))
+		return nil
+	}
+	elem := reflect.New(elemType)
+	if err := decode(t, elem.Elem(), seen); err != nil {
+		return err
+	}
+	field.Set(elem)
+	return nil
+}
+
+// assignUserData reuses the Go pointer already stored in ud.Value,
+// provided its type matches field.
+func assignUserData(ud *lua.LUserData, field reflect.Value) error {
+	v := reflect.ValueOf(ud.Value)
+	if !v.IsValid() || !v.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("cannot assign %T to %s", ud.Value, field.Type())
+	}
+	field.Set(v)
+	return nil
+}
+
+// decodeBlock marshals t into a *Block, returning the existing instance if
+// t has already been seen.
+func decodeBlock(t *lua.LTable, seen map[*lua.LTable]*Block) (*Block, error) {
+	if b, ok := seen[t]; ok {
+		return b, nil
+	}
+	b := &Block{}
+	seen[t] = b
+	if err := decode(t, reflect.ValueOf(b).Elem(), seen); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// decodeSlice marshals the array part of t (indices 1..MaxN) into field,
+// which must be a settable slice value.
+func decodeSlice(t *lua.LTable, field reflect.Value, seen map[*lua.LTable]*Block) error {
+	n := t.MaxN()
+	elemType := field.Type().Elem()
+	out := reflect.MakeSlice(field.Type(), 0, n)
+	for i := 1; i <= n; i++ {
+		lv := t.RawGetInt(i)
+		if lv == lua.LNil {
+			continue
+		}
+		elem := reflect.New(elemType).Elem()
+		if err := assign(lv, elem, seen); err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+		out = reflect.Append(out, elem)
+	}
+	field.Set(out)
+	return nil
+}
+
+// ChainLength walks the chain of first connections starting at source's
+// block and returns its length. It tracks visited blocks explicitly so a
+// cyclic graph (now possible now that Blocks are shared by pointer)
+// terminates instead of looping forever.
+func ChainLength(source *Source) int {
+	visited := make(map[*Block]bool)
+	depth := 0
+	b := source.Block
+	for b != nil && len(b.Connections) > 0 && !visited[b] {
+		visited[b] = true
+		depth++
+		b = b.Connections[0].To
+	}
+	return depth
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// cyclicSetup mirrors the shape setup.lua returns: { aim.cn, aim.sources }.
+// b1 and b2 point at each other, so Load must not recurse forever on it.
+const cyclicSetup = `
+local b1 = { id = "b1", kind = "belt", connections = {} }
+local b2 = { id = "b2", kind = "belt", connections = {} }
+b1.connections[1] = { to = b2 }
+b2.connections[1] = { to = b1 }
+
+local conveyor = { id = "c1", blocks = { b1, b2 } }
+local cn = { conveyors = { conveyor } }
+
+local sources = { { id = "s1", block = b1 } }
+
+return { cn, sources }
+`
+
+func TestLoadCyclicGraph(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	if err := L.DoString(cyclicSetup); err != nil {
+		t.Fatalf("DoString: %v", err)
+	}
+
+	aim, err := Load(L)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if len(aim.Network.Conveyors) != 1 || len(aim.Network.Conveyors[0].Blocks) != 2 {
+		t.Fatalf("unexpected topology shape: %+v", aim.Network)
+	}
+
+	b1, b2 := aim.Network.Conveyors[0].Blocks[0], aim.Network.Conveyors[0].Blocks[1]
+	if b1.Connections[0].To != b2 {
+		t.Errorf("b1 connects to a different *Block than conv.Blocks[1]; cycle broke pointer identity")
+	}
+	if b2.Connections[0].To != b1 {
+		t.Errorf("b2 connects to a different *Block than conv.Blocks[0]; cycle broke pointer identity")
+	}
+	if len(aim.Sources) != 1 || aim.Sources[0].Block != b1 {
+		t.Errorf("source should share the same *Block pointer as the conveyor's first block")
+	}
+}
+
+func TestChainLengthTerminatesOnCycle(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	if err := L.DoString(cyclicSetup); err != nil {
+		t.Fatalf("DoString: %v", err)
+	}
+	aim, err := Load(L)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// b1 -> b2 -> b1 (already visited): depth should stop at 2, not hang.
+	if got, want := ChainLength(aim.Sources[0]), 2; got != want {
+		t.Errorf("ChainLength() = %d, want %d", got, want)
+	}
+}
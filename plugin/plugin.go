@@ -0,0 +1,152 @@
+// Package plugin turns independent Lua scripts in a directory into a
+// lifecycle-hook extensibility surface for the conveyor simulation. Each
+// script runs in its own *lua.LState and registers callbacks through a
+// global `aim` table (`aim.on_block`, `aim.on_tick`, `aim.on_load`,
+// `aim.set_filter`); the host program dispatches those callbacks at the
+// appropriate points, passing typed Go model values in as gopher-luar
+// userdata so plugin authors can call methods on them directly.
+package plugin
+
+import (
+	"fmt"
+	"path/filepath"
+	"text/template"
+
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+// hook pairs a registered Lua function with the state it belongs to,
+// since an *lua.LFunction can only be called against its own LState.
+type hook struct {
+	state *lua.LState
+	fn    *lua.LFunction
+}
+
+func (h hook) call(args ...interface{}) (lua.LValue, error) {
+	luaArgs := make([]lua.LValue, len(args))
+	for i, a := range args {
+		luaArgs[i] = luar.New(h.state, a)
+	}
+	if err := h.state.CallByParam(lua.P{Fn: h.fn, NRet: 1, Protect: true}, luaArgs...); err != nil {
+		return nil, err
+	}
+	ret := h.state.Get(-1)
+	h.state.Pop(1)
+	return ret, nil
+}
+
+// Manager owns the LStates backing a directory of loaded plugins and the
+// hooks they registered.
+type Manager struct {
+	states  []*lua.LState
+	onBlock map[string][]hook
+	onTick  []hook
+	onLoad  []hook
+	filters template.FuncMap
+}
+
+// Load globs dir for *.lua files and runs each one in its own *lua.LState,
+// collecting whatever hooks it registers through the `aim` global.
+func Load(dir string) (*Manager, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("plugin: globbing %s: %w", dir, err)
+	}
+
+	m := &Manager{
+		onBlock: make(map[string][]hook),
+		filters: make(template.FuncMap),
+	}
+	for _, path := range paths {
+		L := lua.NewState()
+		m.registerAim(L)
+		if err := L.DoFile(path); err != nil {
+			m.Close()
+			return nil, fmt.Errorf("plugin: loading %s: %w", path, err)
+		}
+		m.states = append(m.states, L)
+	}
+	return m, nil
+}
+
+// registerAim installs the `aim` global table that plugin scripts use to
+// register lifecycle hooks.
+func (m *Manager) registerAim(L *lua.LState) {
+	aim := L.NewTable()
+
+	L.SetField(aim, "on_block", L.NewFunction(func(L *lua.LState) int {
+		kind := L.CheckString(1)
+		fn := L.CheckFunction(2)
+		m.onBlock[kind] = append(m.onBlock[kind], hook{state: L, fn: fn})
+		return 0
+	}))
+	L.SetField(aim, "on_tick", L.NewFunction(func(L *lua.LState) int {
+		fn := L.CheckFunction(1)
+		m.onTick = append(m.onTick, hook{state: L, fn: fn})
+		return 0
+	}))
+	L.SetField(aim, "on_load", L.NewFunction(func(L *lua.LState) int {
+		fn := L.CheckFunction(1)
+		m.onLoad = append(m.onLoad, hook{state: L, fn: fn})
+		return 0
+	}))
+	L.SetField(aim, "set_filter", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		h := hook{state: L, fn: L.CheckFunction(2)}
+		m.filters[name] = func(args ...interface{}) (interface{}, error) {
+			return h.call(args...)
+		}
+		return 0
+	}))
+
+	L.SetGlobal("aim", aim)
+}
+
+// FireOnLoad runs every registered on_load hook, passing it the freshly
+// marshalled topology.
+func (m *Manager) FireOnLoad(a *model.Aim) error {
+	for _, h := range m.onLoad {
+		if _, err := h.call(a); err != nil {
+			return fmt.Errorf("plugin: on_load hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// FireOnTick runs every registered on_tick hook for the given simulation
+// step.
+func (m *Manager) FireOnTick(tick int) error {
+	for _, h := range m.onTick {
+		if _, err := h.call(tick); err != nil {
+			return fmt.Errorf("plugin: on_tick hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// FireOnBlock runs every on_block hook registered for b.Kind, passing it
+// b as a gopher-luar userdata value.
+func (m *Manager) FireOnBlock(b *model.Block) error {
+	for _, h := range m.onBlock[b.Kind] {
+		if _, err := h.call(b); err != nil {
+			return fmt.Errorf("plugin: on_block(%s) hook: %w", b.Kind, err)
+		}
+	}
+	return nil
+}
+
+// Filters returns the filters registered via aim.set_filter, keyed by
+// name, ready to be merged into a text/template.FuncMap.
+func (m *Manager) Filters() template.FuncMap {
+	return m.filters
+}
+
+// Close shuts down every LState backing a loaded plugin.
+func (m *Manager) Close() {
+	for _, L := range m.states {
+		L.Close()
+	}
+}
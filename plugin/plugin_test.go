@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+func writePlugin(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+		t.Fatalf("writing plugin %s: %v", name, err)
+	}
+}
+
+func TestLoadDispatchesLifecycleHooks(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "hooks.lua", `
+		on_load_calls = 0
+		aim.on_load(function(a) on_load_calls = on_load_calls + 1 end)
+
+		tick_seen = {}
+		aim.on_tick(function(tick) tick_seen[#tick_seen+1] = tick end)
+
+		blocks_seen = {}
+		aim.on_block("source", function(b) blocks_seen[#blocks_seen+1] = b.ID end)
+	`)
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.FireOnLoad(&model.Aim{}); err != nil {
+		t.Fatalf("FireOnLoad: %v", err)
+	}
+	if err := m.FireOnTick(0); err != nil {
+		t.Fatalf("FireOnTick(0): %v", err)
+	}
+	if err := m.FireOnTick(1); err != nil {
+		t.Fatalf("FireOnTick(1): %v", err)
+	}
+
+	if err := m.FireOnBlock(&model.Block{ID: "b1", Kind: "source"}); err != nil {
+		t.Fatalf("FireOnBlock(source): %v", err)
+	}
+	if err := m.FireOnBlock(&model.Block{ID: "b2", Kind: "sink"}); err != nil {
+		t.Fatalf("FireOnBlock(sink): %v", err)
+	}
+
+	if len(m.states) != 1 {
+		t.Fatalf("expected 1 loaded plugin state, got %d", len(m.states))
+	}
+	L := m.states[0]
+
+	if got := L.GetGlobal("on_load_calls"); got.(lua.LNumber) != 1 {
+		t.Errorf("on_load_calls = %v, want 1", got)
+	}
+
+	tickSeen, ok := L.GetGlobal("tick_seen").(*lua.LTable)
+	if !ok || tickSeen.Len() != 2 {
+		t.Fatalf("tick_seen = %v, want a table with 2 entries", L.GetGlobal("tick_seen"))
+	}
+	if got := tickSeen.RawGetInt(1); got.(lua.LNumber) != 0 {
+		t.Errorf("tick_seen[1] = %v, want 0", got)
+	}
+	if got := tickSeen.RawGetInt(2); got.(lua.LNumber) != 1 {
+		t.Errorf("tick_seen[2] = %v, want 1", got)
+	}
+
+	blocksSeen, ok := L.GetGlobal("blocks_seen").(*lua.LTable)
+	if !ok || blocksSeen.Len() != 1 || blocksSeen.RawGetInt(1).String() != "b1" {
+		t.Errorf("on_block(\"source\") should have only seen block b1, got %v", L.GetGlobal("blocks_seen"))
+	}
+}
+
+func TestFiltersRunsRegisteredSetFilter(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "filters.lua", `
+		aim.set_filter("shout", function(s) return s .. "!!!" end)
+	`)
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	defer m.Close()
+
+	filters := m.Filters()
+	shoutAny, ok := filters["shout"]
+	if !ok {
+		t.Fatalf("Filters() missing \"shout\"")
+	}
+	shout, ok := shoutAny.(func(...interface{}) (interface{}, error))
+	if !ok {
+		t.Fatalf("Filters()[\"shout\"] has type %T, want func(...interface{}) (interface{}, error)", shoutAny)
+	}
+
+	result, err := shout("hi")
+	if err != nil {
+		t.Fatalf("shout(\"hi\"): %v", err)
+	}
+	lv, ok := result.(lua.LValue)
+	if !ok {
+		t.Fatalf("shout(\"hi\") returned %T, want lua.LValue", result)
+	}
+	if got, want := lv.String(), "hi!!!"; got != want {
+		t.Errorf("shout(\"hi\") = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+// Package sim runs a loaded conveyor network as a discrete-time
+// simulation on top of gopher-lua's coroutine API. Every Source or Block
+// with an attached Lua behavior function gets its own coroutine; each
+// Step resumes every coroutine once and routes whatever it yields along
+// to the next node, to be picked up the next time that node is resumed:
+// later in the same Step if it runs after the sender, otherwise on the
+// following Step.
+package sim
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+
+	"github.com/AndreiNekrasOn/aim/model"
+)
+
+// thread is a running coroutine for a Source or a Block. inboxKey is the
+// Block this thread collects queued items from (nil for Source threads,
+// which have nothing upstream), and deliverTo is the Block any yielded
+// or returned values get queued on.
+type thread struct {
+	label     string
+	self      interface{}
+	fn        *lua.LFunction
+	co        *lua.LState
+	cancel    context.CancelFunc
+	inboxKey  *model.Block
+	deliverTo *model.Block
+	done      bool
+}
+
+// Engine drives one simulation run over a loaded topology.
+type Engine struct {
+	L       *lua.LState
+	threads []*thread
+	inbox   map[*model.Block][]lua.LValue
+}
+
+// New spawns one coroutine per Source and Block in a that has a behavior
+// function attached. Sources run first each tick, since they are where
+// items enter the network; blocks then run in topological order over
+// Connections, so a block only runs after everything that feeds it has
+// had a chance to deliver this tick. Blocks on a cycle, and blocks
+// downstream of one, have no well-defined topological position, so they
+// run last, in declaration order among themselves.
+func New(L *lua.LState, a *model.Aim) *Engine {
+	e := &Engine{L: L, inbox: make(map[*model.Block][]lua.LValue)}
+
+	for _, src := range a.Sources {
+		if src.Behavior == nil {
+			continue
+		}
+		e.threads = append(e.threads, e.spawn(src.ID, src, src.Behavior, nil, src.Block))
+	}
+
+	for _, b := range topoOrder(a.Network.Conveyors) {
+		if b.Behavior == nil {
+			continue
+		}
+		var deliverTo *model.Block
+		if len(b.Connections) > 0 {
+			deliverTo = b.Connections[0].To
+		}
+		e.threads = append(e.threads, e.spawn(b.ID, b, b.Behavior, b, deliverTo))
+	}
+
+	return e
+}
+
+func (e *Engine) spawn(label string, self interface{}, fn *lua.LFunction, inboxKey, deliverTo *model.Block) *thread {
+	co, cancel := e.L.NewThread()
+	return &thread{
+		label:     label,
+		self:      self,
+		fn:        fn,
+		co:        co,
+		cancel:    cancel,
+		inboxKey:  inboxKey,
+		deliverTo: deliverTo,
+	}
+}
+
+// Step resumes every still-running coroutine once, passing it the owning
+// Source/Block plus any items queued for it, and routes whatever it
+// yields or returns to deliverTo.
+func (e *Engine) Step(tick int) error {
+	for _, t := range e.threads {
+		if t.done {
+			continue
+		}
+
+		var items []lua.LValue
+		if t.inboxKey != nil {
+			items = e.inbox[t.inboxKey]
+			delete(e.inbox, t.inboxKey)
+		}
+		args := make([]lua.LValue, 0, len(items)+1)
+		args = append(args, luar.New(e.L, t.self))
+		args = append(args, items...)
+
+		state, err, values := e.L.Resume(t.co, t.fn, args...)
+		switch state {
+		case lua.ResumeError:
+			log.Printf("sim: tick %d: %s: %v", tick, t.label, err)
+			t.done = true
+		case lua.ResumeOK:
+			t.done = true
+			e.deliver(t.deliverTo, values)
+		case lua.ResumeYield:
+			e.deliver(t.deliverTo, values)
+		}
+	}
+	return nil
+}
+
+// deliver queues values on target, to be handed to target's thread the
+// next time it is resumed.
+func (e *Engine) deliver(target *model.Block, values []lua.LValue) {
+	if target == nil || len(values) == 0 {
+		return
+	}
+	e.inbox[target] = append(e.inbox[target], values...)
+}
+
+// Close cancels every coroutine's context. Call it once the Engine is no
+// longer being stepped.
+func (e *Engine) Close() {
+	for _, t := range e.threads {
+		if t.cancel != nil {
+			t.cancel()
+		}
+	}
+}
+
+// topoOrder returns every Block across conveyors in topological order
+// over Connections (a block is only reachable once everything pointing
+// at it has run), falling back to declaration order for blocks that sit
+// on or downstream of a cycle and so never reach indegree zero.
+func topoOrder(conveyors []*model.Conveyor) []*model.Block {
+	var all []*model.Block
+	seen := make(map[*model.Block]bool)
+	for _, conv := range conveyors {
+		for _, b := range conv.Blocks {
+			if !seen[b] {
+				seen[b] = true
+				all = append(all, b)
+			}
+		}
+	}
+
+	indegree := make(map[*model.Block]int, len(all))
+	for _, b := range all {
+		indegree[b] = 0
+	}
+	for _, b := range all {
+		for _, c := range b.Connections {
+			if c.To != nil {
+				if _, ok := indegree[c.To]; ok {
+					indegree[c.To]++
+				}
+			}
+		}
+	}
+
+	queue := make([]*model.Block, 0, len(all))
+	for _, b := range all {
+		if indegree[b] == 0 {
+			queue = append(queue, b)
+		}
+	}
+
+	order := make([]*model.Block, 0, len(all))
+	visited := make(map[*model.Block]bool, len(all))
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		visited[b] = true
+		order = append(order, b)
+
+		for _, c := range b.Connections {
+			if c.To == nil {
+				continue
+			}
+			if _, ok := indegree[c.To]; !ok {
+				continue
+			}
+			indegree[c.To]--
+			if indegree[c.To] == 0 {
+				queue = append(queue, c.To)
+			}
+		}
+	}
+
+	if len(order) < len(all) {
+		for _, b := range all {
+			if !visited[b] {
+				order = append(order, b)
+			}
+		}
+	}
+
+	return order
+}
+
+// Run steps a fresh Engine for the given number of ticks. If onTick is
+// non-nil, it is called once after every Step with the tick number that
+// just ran, so callers can drive their own per-tick hooks (e.g. a
+// plugin.Manager's FireOnTick) in lockstep with the simulation.
+func Run(L *lua.LState, a *model.Aim, ticks int, onTick func(tick int) error) error {
+	e := New(L, a)
+	defer e.Close()
+	for tick := 0; tick < ticks; tick++ {
+		if err := e.Step(tick); err != nil {
+			return fmt.Errorf("sim: tick %d: %w", tick, err)
+		}
+		if onTick != nil {
+			if err := onTick(tick); err != nil {
+				return fmt.Errorf("sim: tick %d: on-tick hook: %w", tick, err)
+			}
+		}
+	}
+	return nil
+}